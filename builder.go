@@ -0,0 +1,135 @@
+package hipchat
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+const (
+	// maxMessageLength is the API's limit on MessageRequest.Message.
+	maxMessageLength = 10000
+
+	// maxFromLength is the API's limit on MessageRequest.From.
+	maxFromLength = 15
+)
+
+// MessageBuilder composes a message body via fluent calls, escaping HTML
+// as needed and tracking a plain-text fallback alongside it, so callers
+// don't have to hand-escape HTML themselves when using FormatHTML.
+//
+// @mentions and emoticons only work in FormatText messages, while markup
+// like Bold, Link, Code, and Image requires FormatHTML; Build picks
+// whichever format the features used require.
+type MessageBuilder struct {
+	textParts []string
+	htmlParts []string
+
+	usesTextOnlyFeature bool // Mention, Emoticon
+	usesHTMLOnlyFeature bool // Bold, Link, Code, Image
+}
+
+// NewMessageBuilder returns an empty MessageBuilder.
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// Text appends plain, unformatted text.
+func (b *MessageBuilder) Text(s string) *MessageBuilder {
+	b.textParts = append(b.textParts, s)
+	b.htmlParts = append(b.htmlParts, html.EscapeString(s))
+	return b
+}
+
+// Bold appends s rendered in bold. Requires FormatHTML.
+func (b *MessageBuilder) Bold(s string) *MessageBuilder {
+	b.textParts = append(b.textParts, s)
+	b.htmlParts = append(b.htmlParts, "<b>"+html.EscapeString(s)+"</b>")
+	b.usesHTMLOnlyFeature = true
+	return b
+}
+
+// Link appends text rendered as a hyperlink to url. Requires FormatHTML.
+func (b *MessageBuilder) Link(url, text string) *MessageBuilder {
+	b.textParts = append(b.textParts, fmt.Sprintf("%s (%s)", text, url))
+	b.htmlParts = append(b.htmlParts, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), html.EscapeString(text)))
+	b.usesHTMLOnlyFeature = true
+	return b
+}
+
+// Code appends src rendered as a preformatted code block. lang is
+// currently unused but accepted for future syntax highlighting support.
+// Requires FormatHTML.
+func (b *MessageBuilder) Code(lang, src string) *MessageBuilder {
+	b.textParts = append(b.textParts, src)
+	b.htmlParts = append(b.htmlParts, "<pre><code>"+html.EscapeString(src)+"</code></pre>")
+	b.usesHTMLOnlyFeature = true
+	return b
+}
+
+// Image appends an inline image preview for url. Requires FormatHTML.
+func (b *MessageBuilder) Image(url string) *MessageBuilder {
+	b.textParts = append(b.textParts, url)
+	b.htmlParts = append(b.htmlParts, fmt.Sprintf(`<img src="%s">`, html.EscapeString(url)))
+	b.usesHTMLOnlyFeature = true
+	return b
+}
+
+// Mention appends an @mention of user. Requires FormatText.
+func (b *MessageBuilder) Mention(user string) *MessageBuilder {
+	mention := "@" + user
+	b.textParts = append(b.textParts, mention)
+	b.htmlParts = append(b.htmlParts, html.EscapeString(mention))
+	b.usesTextOnlyFeature = true
+	return b
+}
+
+// Emoticon appends a HipChat emoticon shortcode, e.g. "(shipit)". Requires
+// FormatText.
+func (b *MessageBuilder) Emoticon(name string) *MessageBuilder {
+	emoticon := "(" + name + ")"
+	b.textParts = append(b.textParts, emoticon)
+	b.htmlParts = append(b.htmlParts, html.EscapeString(emoticon))
+	b.usesTextOnlyFeature = true
+	return b
+}
+
+// Build returns the composed message body and the format it must be sent
+// with, or an error if the builder mixes FormatText-only and
+// FormatHTML-only features, or if the resulting body exceeds the API's
+// 10,000 character limit.
+func (b *MessageBuilder) Build() (body, format string, err error) {
+	if b.usesTextOnlyFeature && b.usesHTMLOnlyFeature {
+		return "", "", errors.New("hipchat: MessageBuilder mixes @mentions/emoticons (FormatText) with markup (FormatHTML)")
+	}
+
+	format = FormatHTML
+	body = strings.Join(b.htmlParts, "")
+	if b.usesTextOnlyFeature {
+		format = FormatText
+		body = strings.Join(b.textParts, "")
+	}
+
+	if len(body) > maxMessageLength {
+		return "", "", fmt.Errorf("hipchat: message body of %d characters exceeds the %d character limit", len(body), maxMessageLength)
+	}
+	return body, format, nil
+}
+
+// SetBody sets req's Message and MessageFormat from b, validating the
+// message length and req.From's length up front rather than leaving the
+// caller to discover a rejected payload after a round trip to the API.
+func (req *MessageRequest) SetBody(b *MessageBuilder) error {
+	if len(req.From) > maxFromLength {
+		return fmt.Errorf("hipchat: MessageRequest.From %q exceeds the %d character limit", req.From, maxFromLength)
+	}
+
+	body, format, err := b.Build()
+	if err != nil {
+		return err
+	}
+	req.Message = body
+	req.MessageFormat = format
+	return nil
+}
@@ -0,0 +1,63 @@
+package hipchat
+
+import (
+	"html"
+	"strings"
+	"testing"
+)
+
+// FuzzMessageBuilderText verifies that Text's HTML escaping round-trips:
+// unescaping Build's output always recovers the original input, so no
+// HipChat-rejecting unescaped markup can leak into a FormatHTML body.
+func FuzzMessageBuilderText(f *testing.F) {
+	f.Add("hello & <world> \"quoted\" 'it'")
+	f.Add("")
+	f.Add(strings.Repeat("a", maxMessageLength+1))
+
+	f.Fuzz(func(t *testing.T, s string) {
+		body, format, err := NewMessageBuilder().Text(s).Build()
+		if escaped := html.EscapeString(s); len(escaped) > maxMessageLength {
+			if err == nil {
+				t.Fatalf("Build() with a %d-character escaped body returned no error", len(escaped))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Build(): %v", err)
+		}
+		if format != FormatHTML {
+			t.Fatalf("format = %q, want %q", format, FormatHTML)
+		}
+		if got := html.UnescapeString(body); got != s {
+			t.Fatalf("Build() body = %q; unescaping it gives %q, want %q", body, got, s)
+		}
+	})
+}
+
+// FuzzMessageBuilderMention verifies Mention's output always round-trips
+// to "@"+user the same way, and never mixes FormatText-only features
+// with FormatHTML-only ones.
+func FuzzMessageBuilderMention(f *testing.F) {
+	f.Add("jsmith")
+	f.Add("<script>")
+
+	f.Fuzz(func(t *testing.T, user string) {
+		body, format, err := NewMessageBuilder().Mention(user).Build()
+		want := "@" + user
+		if len(want) > maxMessageLength {
+			if err == nil {
+				t.Fatalf("Build() with a %d-character body returned no error", len(want))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Build(): %v", err)
+		}
+		if format != FormatText {
+			t.Fatalf("format = %q, want %q", format, FormatText)
+		}
+		if body != want {
+			t.Fatalf("Build() body = %q, want %q", body, want)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package hipchat
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultRoomCacheTTL is how long a cached room list is considered fresh
+// when Client.RoomCacheTTL is unset.
+const defaultRoomCacheTTL = 5 * time.Minute
+
+// roomCache is an immutable snapshot of the room list, indexed for fast
+// lookup by name and ID. A fresh roomCache is built and swapped in on
+// refresh rather than mutated in place, so readers never block on a
+// refresh in flight.
+type roomCache struct {
+	byName    map[string]*Room
+	byID      map[int]*Room
+	fetchedAt time.Time
+}
+
+func (c *Client) cacheTTL() time.Duration {
+	if c.RoomCacheTTL > 0 {
+		return c.RoomCacheTTL
+	}
+	return defaultRoomCacheTTL
+}
+
+// refreshRoomCache fetches the current room list and atomically swaps it
+// in as the Client's cache. The write lock is held only long enough to
+// swap the pointer, not for the duration of the HTTP fetch.
+func (c *Client) refreshRoomCache(ctx context.Context) error {
+	rooms, err := c.RoomListContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]*Room, len(rooms))
+	byID := make(map[int]*Room, len(rooms))
+	for i := range rooms {
+		r := &rooms[i]
+		byName[r.Name] = r
+		byID[r.RoomId] = r
+	}
+	fresh := &roomCache{byName: byName, byID: byID, fetchedAt: time.Now()}
+
+	c.cacheMu.Lock()
+	c.cache = fresh
+	c.cacheMu.Unlock()
+	return nil
+}
+
+// roomCacheContext returns a fresh-enough roomCache, refreshing it first
+// if it's missing or older than Client.cacheTTL(). If the refresh fails
+// and a (stale) cache is already available, the stale cache is returned
+// rather than the error.
+func (c *Client) roomCacheContext(ctx context.Context) (*roomCache, error) {
+	c.cacheMu.RLock()
+	cache := c.cache
+	c.cacheMu.RUnlock()
+
+	if cache != nil && time.Since(cache.fetchedAt) < c.cacheTTL() {
+		return cache, nil
+	}
+
+	if err := c.refreshRoomCache(ctx); err != nil {
+		if cache != nil {
+			return cache, nil
+		}
+		return nil, err
+	}
+
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	return c.cache, nil
+}
+
+// RoomByName resolves name against the room cache using
+// context.Background(). See RoomByNameContext.
+func (c *Client) RoomByName(name string) (*Room, error) {
+	return c.RoomByNameContext(context.Background(), name)
+}
+
+// RoomByNameContext resolves name against the room cache, refreshing it
+// first if it's missing or stale.
+func (c *Client) RoomByNameContext(ctx context.Context, name string) (*Room, error) {
+	cache, err := c.roomCacheContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	room, ok := cache.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("hipchat: no room named %q", name)
+	}
+	return room, nil
+}
+
+// RoomByID resolves id against the room cache using context.Background().
+// See RoomByIDContext.
+func (c *Client) RoomByID(id int) (*Room, error) {
+	return c.RoomByIDContext(context.Background(), id)
+}
+
+// RoomByIDContext resolves id against the room cache, refreshing it first
+// if it's missing or stale.
+func (c *Client) RoomByIDContext(ctx context.Context, id int) (*Room, error) {
+	cache, err := c.roomCacheContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	room, ok := cache.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("hipchat: no room with id %d", id)
+	}
+	return room, nil
+}
+
+// StartRoomCacheRefresh starts a background goroutine that refreshes the
+// room cache every interval, until ctx is done. It's safe to call
+// alongside RoomByName/RoomByID, which refresh the cache on demand
+// themselves if it's ever missing or stale.
+func (c *Client) StartRoomCacheRefresh(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.refreshRoomCache(ctx)
+			}
+		}
+	}()
+}
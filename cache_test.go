@@ -0,0 +1,38 @@
+package hipchat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRoomByNameConcurrentWithRefresh hammers RoomByName while background
+// refreshes are happening concurrently, under the race detector, to
+// verify the room cache is safe for concurrent use.
+func TestRoomByNameConcurrentWithRefresh(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Rooms":[{"room_id":1,"Name":"lobby"}]}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{AuthToken: "tok", BaseURL: srv.URL, RoomCacheTTL: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.StartRoomCacheRefresh(ctx, time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.RoomByNameContext(context.Background(), "lobby"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -2,16 +2,29 @@
 package hipchat
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
-	defaultBaseURL = "https://api.hipchat.com/v1"
+	defaultBaseURL   = "https://api.hipchat.com/v1"
+	defaultBaseURLV2 = "https://api.hipchat.com/v2"
+
+	// APIVersion1 talks to the deprecated v1 REST API, authenticating via
+	// an auth_token query string parameter. This is the default for
+	// backwards compatibility.
+	APIVersion1 = "v1"
+
+	// APIVersion2 talks to the v2 REST API, authenticating via an
+	// Authorization: Bearer header.
+	APIVersion2 = "v2"
 
 	ColorYellow = "yellow"
 	ColorRed    = "red"
@@ -63,6 +76,13 @@ type MessageRequest struct {
 	// Whether to test authentication. Note: the normal actions will NOT be performed.
 	// (default: false)
 	AuthTest bool
+
+	// Server overrides the Client's BaseURL for this request only. Useful
+	// for routing a single message to a self-hosted or internal HipChat
+	// server without reconfiguring the Client. May be a bare host (e.g.
+	// "hipchat.internal.example") or a full URL; bare hosts are assumed
+	// to be HTTPS.
+	Server string
 }
 
 type AuthResponse struct {
@@ -86,15 +106,108 @@ type ErrorResponse struct {
 type Client struct {
 	AuthToken string
 	BaseURL   string
+
+	// APIVersion selects which HipChat REST API generation requests are
+	// made against: APIVersion1 (default) or APIVersion2. v2-compatible
+	// servers (including Stride-compatible deployments) require this to
+	// be set to APIVersion2.
+	APIVersion string
+
+	// HTTPClient is used to make requests. If nil, a *http.Client with a
+	// 30 second timeout is used.
+	HTTPClient *http.Client
+
+	// RoomCacheTTL controls how long the room cache used by RoomByName
+	// and RoomByID is considered fresh before it's refreshed on next use.
+	// If zero, defaultRoomCacheTTL is used.
+	RoomCacheTTL time.Duration
+
+	limiterOnce     sync.Once
+	rateLimiterImpl *rateLimiter
+
+	httpClientOnce sync.Once
+	httpClientImpl *http.Client
+
+	cacheMu sync.RWMutex
+	cache   *roomCache
 }
 
 // NewClient allocates and returns a Client with the given authToken.
-// By default, the client will use the publicly available HipChat servers.
-// For internal or custom servers, set the BaseURL field of the Client.
+// By default, the client will use the publicly available HipChat servers
+// and the v1 API. For internal or custom servers, set the BaseURL field
+// of the Client. For v2-capable servers, set APIVersion to APIVersion2.
 func NewClient(authToken string) Client {
 	return Client{AuthToken: authToken, BaseURL: defaultBaseURL}
 }
 
+// effectiveBaseURL resolves the base URL to use for a request, preferring
+// (in order) a per-request Server override, the Client's BaseURL, and
+// finally the default for the Client's APIVersion. A BaseURL left at the
+// v1 default (as set by NewClient) counts as unset for an APIVersion2
+// Client. The result is normalized to always include a scheme and never
+// have a trailing slash.
+func (c *Client) effectiveBaseURL(server string) string {
+	raw := server
+	if len(raw) == 0 && !(c.APIVersion == APIVersion2 && c.BaseURL == defaultBaseURL) {
+		raw = c.BaseURL
+	}
+	if len(raw) == 0 {
+		if c.APIVersion == APIVersion2 {
+			raw = defaultBaseURLV2
+		} else {
+			raw = defaultBaseURL
+		}
+	}
+	return normalizeServerURL(raw)
+}
+
+// effectiveBaseURLV2 resolves the base URL for endpoints that only exist
+// on the v2 REST API (e.g. webhooks), regardless of the Client's
+// configured APIVersion: a Client left on the v1 default still needs
+// these requests routed to the v2 host. It honors Client.BaseURL only
+// when the caller has pointed it somewhere other than the v1 default
+// (i.e. a self-hosted server), falling back to defaultBaseURLV2
+// otherwise.
+func (c *Client) effectiveBaseURLV2() string {
+	if len(c.BaseURL) > 0 && c.BaseURL != defaultBaseURL {
+		return normalizeServerURL(c.BaseURL)
+	}
+	return normalizeServerURL(defaultBaseURLV2)
+}
+
+// normalizeServerURL ensures server has a scheme (assuming https when one
+// isn't present, e.g. for a bare host like "hipchat.internal.example") and
+// strips any trailing slash.
+func normalizeServerURL(server string) string {
+	server = strings.TrimRight(server, "/")
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	return server
+}
+
+// v2MessageRequest is the JSON body sent to POST /v2/room/{room}/notification.
+type v2MessageRequest struct {
+	Message       string `json:"message"`
+	MessageFormat string `json:"message_format,omitempty"`
+	Color         string `json:"color,omitempty"`
+	Notify        bool   `json:"notify,omitempty"`
+	From          string `json:"from,omitempty"`
+}
+
+func v2MessageRequestFromMessageRequest(req MessageRequest) (v2MessageRequest, error) {
+	if len(req.RoomId) == 0 || len(req.Message) == 0 {
+		return v2MessageRequest{}, errors.New("The RoomId and Message fields are required.")
+	}
+	return v2MessageRequest{
+		Message:       req.Message,
+		MessageFormat: req.MessageFormat,
+		Color:         req.Color,
+		Notify:        req.Notify,
+		From:          req.From,
+	}, nil
+}
+
 func urlValuesFromMessageRequest(req MessageRequest) (url.Values, error) {
 	if len(req.RoomId) == 0 || len(req.From) == 0 || len(req.Message) == 0 {
 		return nil, errors.New("The RoomId, From, and Message fields are all required.")
@@ -116,11 +229,20 @@ func urlValuesFromMessageRequest(req MessageRequest) (url.Values, error) {
 	return payload, nil
 }
 
+// PostMessage sends req using context.Background(). See PostMessageContext.
 func (c *Client) PostMessage(req MessageRequest) error {
-	if len(c.BaseURL) == 0 {
-		c.BaseURL = defaultBaseURL
+	return c.PostMessageContext(context.Background(), req)
+}
+
+// PostMessageContext sends req, retrying and rate-limiting through the
+// Client's shared transport (see Client.HTTPClient).
+func (c *Client) PostMessageContext(ctx context.Context, req MessageRequest) error {
+	if c.APIVersion == APIVersion2 {
+		return c.postMessageV2Context(ctx, req)
 	}
-	uri := fmt.Sprintf("%s/rooms/message?auth_token=%s", c.BaseURL, url.QueryEscape(c.AuthToken))
+
+	baseURL := c.effectiveBaseURL(req.Server)
+	uri := fmt.Sprintf("%s/rooms/message?auth_token=%s", baseURL, url.QueryEscape(c.AuthToken))
 	if req.AuthTest {
 		uri += "&auth_test=true"
 	}
@@ -130,12 +252,12 @@ func (c *Client) PostMessage(req MessageRequest) error {
 		return err
 	}
 
-	resp, err := http.PostForm(uri, payload)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	_, body, err := c.do(ctx, request{
+		method:  "POST",
+		uri:     uri,
+		headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		payload: []byte(payload.Encode()),
+	})
 	if err != nil {
 		return err
 	}
@@ -161,24 +283,63 @@ func (c *Client) PostMessage(req MessageRequest) error {
 	return nil
 }
 
-func (c *Client) RoomHistory(id, date, tz string) ([]Message, error) {
-	if len(c.BaseURL) == 0 {
-		c.BaseURL = defaultBaseURL
+// postMessageV2Context sends req to the v2 REST API via
+// POST /v2/room/{room}/notification, authenticating with an Authorization:
+// Bearer header rather than an auth_token query parameter.
+func (c *Client) postMessageV2Context(ctx context.Context, req MessageRequest) error {
+	baseURL := c.effectiveBaseURL(req.Server)
+
+	v2Req, err := v2MessageRequestFromMessageRequest(req)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(v2Req)
+	if err != nil {
+		return err
 	}
-	uri := fmt.Sprintf("%s/rooms/history?auth_token=%s&room_id=%s&date=%s&timezone=%s",
-		c.BaseURL, url.QueryEscape(c.AuthToken), url.QueryEscape(id), url.QueryEscape(date), url.QueryEscape(tz))
 
-	resp, err := http.Get(uri)
+	uri := fmt.Sprintf("%s/room/%s/notification", baseURL, url.QueryEscape(req.RoomId))
+	statusCode, body, err := c.do(ctx, request{
+		method: "POST",
+		uri:    uri,
+		headers: map[string]string{
+			"Authorization": "Bearer " + c.AuthToken,
+			"Content-Type":  "application/json",
+		},
+		payload: payload,
+	})
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if statusCode >= 300 {
+		return getError(body)
+	}
+	return nil
+}
+
+// RoomHistory fetches a room's message history using context.Background().
+// See RoomHistoryContext.
+func (c *Client) RoomHistory(id, date, tz string) ([]Message, error) {
+	return c.RoomHistoryContext(context.Background(), id, date, tz)
+}
+
+// RoomHistoryContext fetches a room's message history, retrying and
+// rate-limiting through the Client's shared transport.
+func (c *Client) RoomHistoryContext(ctx context.Context, id, date, tz string) ([]Message, error) {
+	if c.APIVersion == APIVersion2 {
+		return c.roomHistoryV2Context(ctx, id, date, tz)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+
+	baseURL := c.effectiveBaseURL("")
+	uri := fmt.Sprintf("%s/rooms/history?auth_token=%s&room_id=%s&date=%s&timezone=%s",
+		baseURL, url.QueryEscape(c.AuthToken), url.QueryEscape(id), url.QueryEscape(date), url.QueryEscape(tz))
+
+	statusCode, body, err := c.do(ctx, request{method: "GET", uri: uri})
 	if err != nil {
 		return nil, err
 	}
-
-	if resp.StatusCode != http.StatusOK {
+	if statusCode != http.StatusOK {
 		return nil, getError(body)
 	}
 	msgResp := &struct{ Messages []Message }{}
@@ -189,23 +350,94 @@ func (c *Client) RoomHistory(id, date, tz string) ([]Message, error) {
 	return msgResp.Messages, nil
 }
 
-func (c *Client) RoomList() ([]Room, error) {
-	if len(c.BaseURL) == 0 {
-		c.BaseURL = defaultBaseURL
-	}
-	uri := fmt.Sprintf("%s/rooms/list?auth_token=%s", c.BaseURL, url.QueryEscape(c.AuthToken))
-
-	resp, err := http.Get(uri)
+// roomHistoryV2Context fetches a room's message history from the v2 REST
+// API via GET /v2/room/{room}/history, authenticating with an
+// Authorization: Bearer header rather than an auth_token query parameter.
+func (c *Client) roomHistoryV2Context(ctx context.Context, id, date, tz string) ([]Message, error) {
+	baseURL := c.effectiveBaseURL("")
+	uri := fmt.Sprintf("%s/room/%s/history?date=%s&timezone=%s",
+		baseURL, url.QueryEscape(id), url.QueryEscape(date), url.QueryEscape(tz))
+
+	statusCode, body, err := c.do(ctx, request{
+		method:  "GET",
+		uri:     uri,
+		headers: map[string]string{"Authorization": "Bearer " + c.AuthToken},
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	if statusCode != http.StatusOK {
+		return nil, getError(body)
+	}
+	itemsResp := &struct{ Items []v2Message }{}
+	if err := json.Unmarshal(body, itemsResp); err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	messages := make([]Message, len(itemsResp.Items))
+	for i, m := range itemsResp.Items {
+		messages[i] = m.toMessage()
+	}
+	return messages, nil
+}
+
+// v2Message is a single history item as returned by the v2 REST API's
+// GET /v2/room/{room}/history, which (unlike v1) nests the sender under
+// "from" and uses "message"/"date" rather than capitalized field names.
+type v2Message struct {
+	Date    string          `json:"date"`
+	Message string          `json:"message"`
+	From    v2MessageSender `json:"from"`
+}
+
+func (m v2Message) toMessage() Message {
+	return Message{From: m.From.Name, Message: m.Message, Date: m.Date}
+}
+
+// v2MessageSender unmarshals a v2 history item's "from" field, which the
+// API represents as a sender object for ordinary messages but as a bare
+// string (the sender's name) for system/notification messages.
+type v2MessageSender struct {
+	Name string
+}
+
+func (s *v2MessageSender) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		s.Name = name
+		return nil
+	}
+	var obj struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	s.Name = obj.Name
+	return nil
+}
+
+// RoomList fetches the list of rooms using context.Background(). See
+// RoomListContext.
+func (c *Client) RoomList() ([]Room, error) {
+	return c.RoomListContext(context.Background())
+}
+
+// RoomListContext fetches the list of rooms, retrying and rate-limiting
+// through the Client's shared transport.
+func (c *Client) RoomListContext(ctx context.Context) ([]Room, error) {
+	if c.APIVersion == APIVersion2 {
+		return c.roomListV2Context(ctx)
+	}
+
+	baseURL := c.effectiveBaseURL("")
+	uri := fmt.Sprintf("%s/rooms/list?auth_token=%s", baseURL, url.QueryEscape(c.AuthToken))
+
+	statusCode, body, err := c.do(ctx, request{method: "GET", uri: uri})
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
 		return nil, getError(body)
 	}
 	roomsResp := &struct{ Rooms []Room }{}
@@ -216,6 +448,60 @@ func (c *Client) RoomList() ([]Room, error) {
 	return roomsResp.Rooms, nil
 }
 
+// roomListV2Context fetches the list of rooms from the v2 REST API via
+// GET /v2/room, authenticating with an Authorization: Bearer header
+// rather than an auth_token query parameter.
+func (c *Client) roomListV2Context(ctx context.Context) ([]Room, error) {
+	baseURL := c.effectiveBaseURL("")
+	uri := fmt.Sprintf("%s/room", baseURL)
+
+	statusCode, body, err := c.do(ctx, request{
+		method:  "GET",
+		uri:     uri,
+		headers: map[string]string{"Authorization": "Bearer " + c.AuthToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, getError(body)
+	}
+	itemsResp := &struct{ Items []v2Room }{}
+	if err := json.Unmarshal(body, itemsResp); err != nil {
+		return nil, err
+	}
+
+	rooms := make([]Room, len(itemsResp.Items))
+	for i, r := range itemsResp.Items {
+		rooms[i] = r.toRoom()
+	}
+	return rooms, nil
+}
+
+// v2Room is a single room as returned by the v2 REST API's GET /v2/room,
+// which (unlike v1) keys rooms by "id" rather than "room_id".
+type v2Room struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Topic        string `json:"topic"`
+	Archived     bool   `json:"is_archived"`
+	Private      bool   `json:"is_private"`
+	OwnerUserId  int    `json:"owner_user_id"`
+	XMPPJabberId string `json:"xmpp_jid"`
+}
+
+func (r v2Room) toRoom() Room {
+	return Room{
+		RoomId:       r.ID,
+		Name:         r.Name,
+		Topic:        r.Topic,
+		Archived:     r.Archived,
+		Private:      r.Private,
+		OwnerUserId:  r.OwnerUserId,
+		XMPPJabberId: r.XMPPJabberId,
+	}
+}
+
 // getError unmarshals a HipChat error response from the request body and
 // returns its error field.
 func getError(body []byte) error {
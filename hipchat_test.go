@@ -0,0 +1,114 @@
+package hipchat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestEffectiveBaseURL verifies that a per-request Server override takes
+// precedence over Client.BaseURL, which in turn takes precedence over the
+// default for the Client's APIVersion.
+func TestEffectiveBaseURL(t *testing.T) {
+	c := &Client{BaseURL: "https://client.example/v1"}
+	if got, want := c.effectiveBaseURL("request.example"), "https://request.example"; got != want {
+		t.Errorf("effectiveBaseURL(request override) = %q, want %q", got, want)
+	}
+	if got, want := c.effectiveBaseURL(""), "https://client.example/v1"; got != want {
+		t.Errorf("effectiveBaseURL(no override) = %q, want %q", got, want)
+	}
+
+	c = &Client{APIVersion: APIVersion2}
+	if got, want := c.effectiveBaseURL(""), defaultBaseURLV2; got != want {
+		t.Errorf("effectiveBaseURL(v2 default) = %q, want %q", got, want)
+	}
+}
+
+// TestRoomListContextHonorsServerOverride verifies that RoomListContext
+// actually sends its request to a server configured via Client.BaseURL,
+// rather than the public default.
+func TestRoomListContextHonorsServerOverride(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(`{"Rooms":[{"room_id":1,"Name":"lobby"}]}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{AuthToken: "tok", BaseURL: srv.URL}
+	rooms, err := c.RoomListContext(context.Background())
+	if err != nil {
+		t.Fatalf("RoomListContext: %v", err)
+	}
+	if len(rooms) != 1 || rooms[0].Name != "lobby" {
+		t.Fatalf("RoomListContext returned %+v, want a single room named lobby", rooms)
+	}
+	if want := "/rooms/list"; gotPath != want {
+		t.Errorf("request path = %q, want %q", gotPath, want)
+	}
+}
+
+// TestRoomListContextV2 verifies that a v2 Client lists rooms via
+// GET /v2/room with Bearer auth, rather than the v1 /rooms/list shape.
+func TestRoomListContextV2(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"items":[{"id":1,"name":"lobby"}]}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{AuthToken: "tok", BaseURL: srv.URL, APIVersion: APIVersion2}
+	rooms, err := c.RoomListContext(context.Background())
+	if err != nil {
+		t.Fatalf("RoomListContext: %v", err)
+	}
+	if len(rooms) != 1 || rooms[0].Name != "lobby" || rooms[0].RoomId != 1 {
+		t.Fatalf("RoomListContext returned %+v, want a single room {RoomId: 1, Name: lobby}", rooms)
+	}
+	if want := "/room"; gotPath != want {
+		t.Errorf("request path = %q, want %q", gotPath, want)
+	}
+	if want := "Bearer tok"; gotAuth != want {
+		t.Errorf("Authorization header = %q, want %q", gotAuth, want)
+	}
+}
+
+// TestRoomHistoryContextV2 verifies that a v2 Client fetches room history
+// via GET /v2/room/{room}/history with Bearer auth, and that a bare
+// string "from" (used for system/notification messages) decodes.
+func TestRoomHistoryContextV2(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"items":[
+			{"date":"2013-05-16T09:41:00-05:00","message":"hi","from":{"name":"jsmith"}},
+			{"date":"2013-05-16T09:42:00-05:00","message":"joined","from":"system"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{AuthToken: "tok", BaseURL: srv.URL, APIVersion: APIVersion2}
+	messages, err := c.RoomHistoryContext(context.Background(), "42", "2013-05-16", "UTC")
+	if err != nil {
+		t.Fatalf("RoomHistoryContext: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("RoomHistoryContext returned %d messages, want 2", len(messages))
+	}
+	if messages[0].From != "jsmith" || messages[0].Message != "hi" {
+		t.Errorf("messages[0] = %+v, want From jsmith, Message hi", messages[0])
+	}
+	if messages[1].From != "system" || messages[1].Message != "joined" {
+		t.Errorf("messages[1] = %+v, want From system, Message joined", messages[1])
+	}
+	if want := "/room/42/history"; gotPath != want {
+		t.Errorf("request path = %q, want %q", gotPath, want)
+	}
+	if want := "Bearer tok"; gotAuth != want {
+		t.Errorf("Authorization header = %q, want %q", gotAuth, want)
+	}
+}
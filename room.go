@@ -1,14 +1,5 @@
 package hipchat
 
-import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
-)
-
 type Room struct {
 	// The ID of the room.
 	RoomId int `json:"room_id"`
@@ -39,30 +30,15 @@ type Room struct {
 	XMPPJabberId string `json:"xmpp_jid"`
 }
 
-func (c *Client) RoomList() ([]Room, error) {
-	uri := fmt.Sprintf("%s/rooms/list?auth_token=%s", baseURL, url.QueryEscape(c.AuthToken))
-
-	resp, err := http.Get(uri)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+// Message is a single entry in a room's history, as returned by
+// Client.RoomHistory.
+type Message struct {
+	// Name the message appears to be sent from.
+	From string
 
-	if resp.StatusCode != 200 {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(body, &errResp); err != nil {
-			return nil, err
-		}
-		return nil, errors.New(errResp.Error.Message)
-	}
-	roomsResp := &struct{ Rooms []Room }{}
-	if err := json.Unmarshal(body, roomsResp); err != nil {
-		return nil, err
-	}
+	// The message body.
+	Message string
 
-	return roomsResp.Rooms, nil
+	// Time the message was sent, in ISO 8601 format.
+	Date string
 }
@@ -0,0 +1,174 @@
+package hipchat
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+
+	// maxRetries bounds how many times a request is retried after a 429
+	// Too Many Requests response before the error is returned to the
+	// caller.
+	maxRetries = 5
+
+	initialRetryBackoff = 500 * time.Millisecond
+
+	// HipChat v1 API tokens are capped at 100 requests per 5 minutes; v2
+	// tokens carry a similar quota, so the same budget is used for both.
+	rateLimitRequests = 100
+	rateLimitWindow   = 5 * time.Minute
+)
+
+// httpClient returns the *http.Client used to make requests, lazily
+// initializing it with a sane default timeout if the caller hasn't
+// configured one. The lazy initialization is guarded the same way as
+// limiter's, so concurrent first calls don't race on Client.HTTPClient.
+func (c *Client) httpClient() *http.Client {
+	c.httpClientOnce.Do(func() {
+		if c.HTTPClient != nil {
+			c.httpClientImpl = c.HTTPClient
+			return
+		}
+		c.httpClientImpl = &http.Client{Timeout: defaultTimeout}
+	})
+	return c.httpClientImpl
+}
+
+// limiter returns the Client's shared rate limiter, lazily creating one
+// sized to HipChat's per-token request quota the first time it's needed.
+func (c *Client) limiter() *rateLimiter {
+	c.limiterOnce.Do(func() {
+		c.rateLimiterImpl = newRateLimiter(rateLimitRequests, rateLimitWindow)
+	})
+	return c.rateLimiterImpl
+}
+
+// request describes a single HTTP call to be made against the HipChat API.
+type request struct {
+	method  string
+	uri     string
+	headers map[string]string
+	payload []byte // nil for requests with no body
+}
+
+// do executes req, waiting on the Client's shared rate limiter beforehand
+// so a burst of local calls doesn't trip HipChat's quota, and
+// transparently retrying on 429 Too Many Requests responses (honoring a
+// Retry-After header when present) with exponential backoff, up to
+// maxRetries times.
+func (c *Client) do(ctx context.Context, req request) (statusCode int, body []byte, err error) {
+	backoff := initialRetryBackoff
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter().Wait(ctx); err != nil {
+			return 0, nil, err
+		}
+
+		var bodyReader io.Reader
+		if req.payload != nil {
+			bodyReader = bytes.NewReader(req.payload)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, req.uri, bodyReader)
+		if err != nil {
+			return 0, nil, err
+		}
+		for k, v := range req.headers {
+			httpReq.Header.Set(k, v)
+		}
+
+		resp, err := c.httpClient().Do(httpReq)
+		if err != nil {
+			return 0, nil, err
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			wait := retryAfter(resp.Header, backoff)
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, nil, ctx.Err()
+			}
+			backoff *= 2
+			continue
+		}
+
+		return resp.StatusCode, respBody, nil
+	}
+}
+
+// retryAfter returns how long to wait before retrying a 429 response,
+// honoring a Retry-After header (given in seconds) when present and
+// falling back to backoff otherwise.
+func retryAfter(header http.Header, backoff time.Duration) time.Duration {
+	if s := header.Get("Retry-After"); len(s) > 0 {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return backoff
+}
+
+// rateLimiter is a token-bucket limiter safe for concurrent use by many
+// goroutines, used to keep a Client within HipChat's per-token request
+// quota.
+type rateLimiter struct {
+	mu         sync.Mutex
+	tokens     float64
+	max        float64
+	refillRate float64 // tokens per second
+	last       time.Time
+}
+
+func newRateLimiter(max int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		tokens:     float64(max),
+		max:        float64(max),
+		refillRate: float64(max) / window.Seconds(),
+		last:       time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (r *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		elapsed := now.Sub(r.last).Seconds()
+		r.tokens += elapsed * r.refillRate
+		if r.tokens > r.max {
+			r.tokens = r.max
+		}
+		r.last = now
+
+		if r.tokens >= 1 {
+			r.tokens--
+			r.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - r.tokens) / r.refillRate * float64(time.Second))
+		r.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package hipchat
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestHTTPClientConcurrent exercises httpClient's lazy initialization
+// under the race detector: many goroutines calling it concurrently on a
+// freshly constructed Client (as happens when PostMessageContext etc. are
+// called concurrently before HTTPClient has been touched) must not race
+// on the underlying field.
+func TestHTTPClientConcurrent(t *testing.T) {
+	c := &Client{}
+
+	var wg sync.WaitGroup
+	results := make([]bool, 100)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.httpClient() != nil
+		}(i)
+	}
+	wg.Wait()
+
+	for i, ok := range results {
+		if !ok {
+			t.Fatalf("goroutine %d: httpClient() returned nil", i)
+		}
+	}
+
+	first := c.httpClient()
+	if c.httpClient() != first {
+		t.Error("httpClient() returned different instances across calls")
+	}
+}
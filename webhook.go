@@ -0,0 +1,56 @@
+package hipchat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// webhookConfig is the JSON body sent to
+// POST /v2/room/{room}/webhook to install a webhook.
+type webhookConfig struct {
+	URL     string `json:"url"`
+	Event   string `json:"event"`
+	Pattern string `json:"pattern,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// RegisterWebhook installs a webhook on roomID using context.Background().
+// See RegisterWebhookContext.
+func (c *Client) RegisterWebhook(roomID, hookURL, event, pattern string) error {
+	return c.RegisterWebhookContext(context.Background(), roomID, hookURL, event, pattern)
+}
+
+// RegisterWebhookContext installs a webhook on roomID via the v2 REST API
+// so that hookURL receives a POST for every occurrence of event (one of
+// "room_message", "room_notification", "room_enter", "room_exit", or
+// "room_topic_change") in the room. pattern, if non-empty, restricts
+// room_message/room_notification webhooks to messages matching a regular
+// expression. The resulting payloads can be decoded with the webhook
+// sub-package's Mux.
+func (c *Client) RegisterWebhookContext(ctx context.Context, roomID, hookURL, event, pattern string) error {
+	payload, err := json.Marshal(webhookConfig{URL: hookURL, Event: event, Pattern: pattern})
+	if err != nil {
+		return err
+	}
+
+	baseURL := c.effectiveBaseURLV2()
+	uri := fmt.Sprintf("%s/room/%s/webhook", baseURL, url.QueryEscape(roomID))
+	statusCode, body, err := c.do(ctx, request{
+		method: "POST",
+		uri:    uri,
+		headers: map[string]string{
+			"Authorization": "Bearer " + c.AuthToken,
+			"Content-Type":  "application/json",
+		},
+		payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+	if statusCode >= 300 {
+		return getError(body)
+	}
+	return nil
+}
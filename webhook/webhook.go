@@ -0,0 +1,159 @@
+// Package webhook provides an http.Handler that decodes HipChat room
+// webhook payloads and dispatches them to registered handlers, so a bot
+// can react to room activity without hand-rolling the JSON schemas or
+// standing up its own routing.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/andybons/hipchat"
+)
+
+// Message is the message payload of a room_message or room_notification
+// event.
+type Message struct {
+	ID      string `json:"id"`
+	Date    string `json:"date"`
+	Message string `json:"message"`
+	From    Sender `json:"from"`
+}
+
+// Sender identifies the user who triggered an event.
+type Sender struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	MentionName string `json:"mention_name"`
+}
+
+// MessageEvent is delivered for room_message and room_notification
+// webhooks.
+type MessageEvent struct {
+	Room    hipchat.Room
+	Message Message
+}
+
+// EnterExitEvent is delivered for room_enter and room_exit webhooks.
+type EnterExitEvent struct {
+	Room   hipchat.Room
+	Sender Sender
+}
+
+// TopicChangeEvent is delivered for room_topic_change webhooks.
+type TopicChangeEvent struct {
+	Room  hipchat.Room
+	Topic string
+}
+
+// payload is the envelope HipChat POSTs for every webhook event.
+type payload struct {
+	Event string `json:"event"`
+	Item  struct {
+		Room    hipchat.Room `json:"room"`
+		Message *Message     `json:"message"`
+		Topic   string       `json:"topic"`
+	} `json:"item"`
+	Sender Sender `json:"sender"`
+}
+
+// Mux decodes incoming HipChat webhook requests and dispatches them to
+// handlers registered via OnMessage, OnNotification, OnEnter, OnExit, and
+// OnTopicChange. The zero value, via New, ignores events with no
+// registered handler.
+type Mux struct {
+	secret string
+
+	onMessage      func(ctx context.Context, e *MessageEvent) error
+	onNotification func(ctx context.Context, e *MessageEvent) error
+	onEnter        func(ctx context.Context, e *EnterExitEvent) error
+	onExit         func(ctx context.Context, e *EnterExitEvent) error
+	onTopicChange  func(ctx context.Context, e *TopicChangeEvent) error
+}
+
+// New returns a Mux that verifies each request's X-Hub-Signature header
+// against secret using HMAC-SHA1. Client.RegisterWebhook does not set a
+// secret on the webhook. If secret is empty, signatures are not checked.
+func New(secret string) *Mux {
+	return &Mux{secret: secret}
+}
+
+func (m *Mux) OnMessage(f func(ctx context.Context, e *MessageEvent) error) { m.onMessage = f }
+func (m *Mux) OnNotification(f func(ctx context.Context, e *MessageEvent) error) {
+	m.onNotification = f
+}
+func (m *Mux) OnEnter(f func(ctx context.Context, e *EnterExitEvent) error) { m.onEnter = f }
+func (m *Mux) OnExit(f func(ctx context.Context, e *EnterExitEvent) error)  { m.onExit = f }
+func (m *Mux) OnTopicChange(f func(ctx context.Context, e *TopicChangeEvent) error) {
+	m.onTopicChange = f
+}
+
+// ServeHTTP implements http.Handler.
+func (m *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(m.secret) > 0 && !validSignature(m.secret, r.Header.Get("X-Hub-Signature"), body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := m.dispatch(r.Context(), p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Mux) dispatch(ctx context.Context, p payload) error {
+	switch p.Event {
+	case "room_message":
+		if m.onMessage != nil && p.Item.Message != nil {
+			return m.onMessage(ctx, &MessageEvent{Room: p.Item.Room, Message: *p.Item.Message})
+		}
+	case "room_notification":
+		if m.onNotification != nil && p.Item.Message != nil {
+			return m.onNotification(ctx, &MessageEvent{Room: p.Item.Room, Message: *p.Item.Message})
+		}
+	case "room_enter":
+		if m.onEnter != nil {
+			return m.onEnter(ctx, &EnterExitEvent{Room: p.Item.Room, Sender: p.Sender})
+		}
+	case "room_exit":
+		if m.onExit != nil {
+			return m.onExit(ctx, &EnterExitEvent{Room: p.Item.Room, Sender: p.Sender})
+		}
+	case "room_topic_change":
+		if m.onTopicChange != nil {
+			return m.onTopicChange(ctx, &TopicChangeEvent{Room: p.Item.Room, Topic: p.Item.Topic})
+		}
+	}
+	return nil
+}
+
+// validSignature reports whether sig is the hex-encoded HMAC-SHA1 of body
+// keyed by secret, prefixed with "sha1=" (mirroring the convention used
+// by other webhook providers).
+func validSignature(secret, sig string, body []byte) bool {
+	if len(sig) == 0 {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha1=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(t *testing.T, m *Mux, body string, sig string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if len(sig) > 0 {
+		req.Header.Set("X-Hub-Signature", sig)
+	}
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServeHTTPDispatchesRoomMessage(t *testing.T) {
+	m := New("")
+	var got *MessageEvent
+	m.OnMessage(func(ctx context.Context, e *MessageEvent) error {
+		got = e
+		return nil
+	})
+
+	body := `{"event":"room_message","item":{"room":{"room_id":1,"Name":"lobby"},"message":{"id":"1","date":"now","message":"hi","from":{"id":2,"name":"jsmith"}}}}`
+	rec := postWebhook(t, m, body, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got == nil {
+		t.Fatal("OnMessage handler was not called")
+	}
+	if got.Room.Name != "lobby" || got.Message.Message != "hi" || got.Message.From.Name != "jsmith" {
+		t.Errorf("MessageEvent = %+v, want Room.Name lobby, Message.Message hi, Message.From.Name jsmith", got)
+	}
+}
+
+func TestServeHTTPDispatchesRoomEnter(t *testing.T) {
+	m := New("")
+	var got *EnterExitEvent
+	m.OnEnter(func(ctx context.Context, e *EnterExitEvent) error {
+		got = e
+		return nil
+	})
+
+	body := `{"event":"room_enter","item":{"room":{"room_id":1,"Name":"lobby"}},"sender":{"id":2,"name":"jsmith"}}`
+	rec := postWebhook(t, m, body, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got == nil {
+		t.Fatal("OnEnter handler was not called")
+	}
+	if got.Room.Name != "lobby" || got.Sender.Name != "jsmith" {
+		t.Errorf("EnterExitEvent = %+v, want Room.Name lobby, Sender.Name jsmith", got)
+	}
+}
+
+func TestServeHTTPDispatchesRoomTopicChange(t *testing.T) {
+	m := New("")
+	var got *TopicChangeEvent
+	m.OnTopicChange(func(ctx context.Context, e *TopicChangeEvent) error {
+		got = e
+		return nil
+	})
+
+	body := `{"event":"room_topic_change","item":{"room":{"room_id":1,"Name":"lobby"},"topic":"new topic"}}`
+	rec := postWebhook(t, m, body, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got == nil {
+		t.Fatal("OnTopicChange handler was not called")
+	}
+	if got.Topic != "new topic" {
+		t.Errorf("TopicChangeEvent.Topic = %q, want %q", got.Topic, "new topic")
+	}
+}
+
+func TestServeHTTPRejectsBadSignature(t *testing.T) {
+	m := New("shh")
+	called := false
+	m.OnEnter(func(ctx context.Context, e *EnterExitEvent) error {
+		called = true
+		return nil
+	})
+
+	body := `{"event":"room_enter","item":{"room":{"room_id":1,"Name":"lobby"}}}`
+	rec := postWebhook(t, m, body, "sha1=deadbeef")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if called {
+		t.Error("handler was called despite an invalid signature")
+	}
+}
+
+func TestServeHTTPVerifiesValidSignature(t *testing.T) {
+	body := `{"event":"room_enter","item":{"room":{"room_id":1,"Name":"lobby"}}}`
+	m := New("shh")
+	called := false
+	m.OnEnter(func(ctx context.Context, e *EnterExitEvent) error {
+		called = true
+		return nil
+	})
+
+	rec := postWebhook(t, m, body, sign("shh", []byte(body)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if !called {
+		t.Error("handler was not called despite a valid signature")
+	}
+}
+
+func TestServeHTTPPassesThroughWithNoSecretConfigured(t *testing.T) {
+	m := New("")
+	called := false
+	m.OnEnter(func(ctx context.Context, e *EnterExitEvent) error {
+		called = true
+		return nil
+	})
+
+	body := `{"event":"room_enter","item":{"room":{"room_id":1,"Name":"lobby"}}}`
+	rec := postWebhook(t, m, body, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if !called {
+		t.Error("handler was not called when no secret was configured and no signature was sent")
+	}
+}
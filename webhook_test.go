@@ -0,0 +1,46 @@
+package hipchat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRegisterWebhookContextUsesV2Host verifies that RegisterWebhookContext
+// always targets the v2 host, even for a Client left on the v1 default
+// (the common case, since NewClient never sets APIVersion).
+func TestRegisterWebhookContextUsesV2Host(t *testing.T) {
+	c := &Client{AuthToken: "tok", BaseURL: defaultBaseURL}
+	if got, want := c.effectiveBaseURLV2(), defaultBaseURLV2; got != want {
+		t.Errorf("effectiveBaseURLV2() with BaseURL left at the v1 default = %q, want %q", got, want)
+	}
+
+	c = &Client{AuthToken: "tok", BaseURL: "https://hipchat.internal.example"}
+	if got, want := c.effectiveBaseURLV2(), "https://hipchat.internal.example"; got != want {
+		t.Errorf("effectiveBaseURLV2() with a custom BaseURL = %q, want %q", got, want)
+	}
+}
+
+// TestRegisterWebhookContextRequest verifies that RegisterWebhookContext
+// sends a Bearer-authenticated v2 request to the expected path.
+func TestRegisterWebhookContextRequest(t *testing.T) {
+	var gotAuth, gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	c := &Client{AuthToken: "tok", BaseURL: srv.URL}
+	if err := c.RegisterWebhookContext(context.Background(), "42", "https://example.com/hook", "room_message", ""); err != nil {
+		t.Fatalf("RegisterWebhookContext: %v", err)
+	}
+	if want := "Bearer tok"; gotAuth != want {
+		t.Errorf("Authorization header = %q, want %q", gotAuth, want)
+	}
+	if want := "/room/42/webhook"; gotPath != want {
+		t.Errorf("request path = %q, want %q", gotPath, want)
+	}
+}
@@ -0,0 +1,89 @@
+package xmpp
+
+import "encoding/xml"
+
+// stanza is the union of the XMPP stanza shapes this package cares about:
+// messages (room chat and topic changes), presence (including MUC join/
+// leave), and roster push IQs.
+type stanza struct {
+	XMLName xml.Name
+
+	From string `xml:"from,attr"`
+	Type string `xml:"type,attr"`
+
+	Body    string `xml:"body"`
+	Subject string `xml:"subject"`
+
+	Show   string `xml:"show"`
+	Status string `xml:"status"`
+
+	Query *rosterQuery `xml:"query"`
+}
+
+// streamFeatures is the <stream:features> element the server sends after
+// opening a stream, advertising e.g. SASL mechanisms or resource binding.
+// Its contents aren't currently inspected; decoding it is only used to
+// consume the element from the stream.
+type streamFeatures struct {
+	XMLName xml.Name `xml:"features"`
+}
+
+// saslResult is the server's reply to a SASL <auth> request: either
+// <success/> or <failure>...</failure>, distinguished by XMLName.Local.
+type saslResult struct {
+	XMLName xml.Name
+}
+
+// bindResponse is the server's reply to a resource bind IQ.
+type bindResponse struct {
+	XMLName xml.Name `xml:"iq"`
+	Type    string   `xml:"type,attr"`
+}
+
+type rosterQuery struct {
+	Items []rosterItem `xml:"item"`
+}
+
+type rosterItem struct {
+	Jid          string `xml:"jid,attr"`
+	Name         string `xml:"name,attr"`
+	Subscription string `xml:"subscription,attr"`
+}
+
+// toEvent translates s into an Event, if it's one of the stanza shapes
+// this package understands.
+func (s stanza) toEvent() (Event, bool) {
+	switch s.XMLName.Local {
+	case "message":
+		switch {
+		case len(s.Subject) > 0:
+			return Event{Type: TopicChangeEvent, Room: jidBare(s.From), From: s.From, Body: s.Subject}, true
+		case len(s.Body) > 0:
+			return Event{Type: MessageEvent, Room: jidBare(s.From), From: s.From, Body: s.Body}, true
+		}
+		return Event{}, false
+
+	case "presence":
+		return Event{Type: PresenceEvent, Room: jidBare(s.From), From: s.From, Show: s.Show, Status: s.Status}, true
+
+	case "iq":
+		if s.Query == nil || len(s.Query.Items) == 0 {
+			return Event{}, false
+		}
+		item := s.Query.Items[0]
+		return Event{Type: RosterEvent, From: item.Jid, Body: item.Name, Subscription: item.Subscription}, true
+
+	default:
+		return Event{}, false
+	}
+}
+
+// jidBare strips the resource part (after "/") from a full JID.
+func jidBare(jid string) string {
+	for i := 0; i < len(jid); i++ {
+		if jid[i] == '/' {
+			return jid[:i]
+		}
+	}
+	return jid
+}
@@ -0,0 +1,370 @@
+// Package xmpp provides a client for HipChat's XMPP (Jabber) interface,
+// used to receive messages and presence over a long-lived connection.
+// The REST API (see the parent hipchat package) has no long-poll or
+// streaming endpoint, so anything that needs to react to room activity
+// in real time — an auto-responder, a bridge, a bot — needs this instead.
+package xmpp
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andybons/hipchat"
+)
+
+// defaultHost is HipChat's public XMPP server.
+const defaultHost = "chat.hipchat.com:5222"
+
+// Config configures a Session.
+type Config struct {
+	// JID is the full Jabber ID to authenticate as, e.g.
+	// "123_456@chat.hipchat.com".
+	JID string
+
+	// Password is the user's API password or OAuth token.
+	Password string
+
+	// Host is the XMPP server to dial, host:port. Defaults to HipChat's
+	// public server.
+	Host string
+
+	// REST, if set, is used by Send to deliver messages over the REST
+	// API rather than as XMPP groupchat stanzas, so callers can pick
+	// whichever transport suits a given message.
+	REST *hipchat.Client
+}
+
+func (c Config) host() string {
+	if len(c.Host) > 0 {
+		return c.Host
+	}
+	return defaultHost
+}
+
+// EventType identifies the kind of Event delivered on Session.Incoming.
+type EventType int
+
+const (
+	MessageEvent EventType = iota
+	PresenceEvent
+	TopicChangeEvent
+	RosterEvent
+)
+
+// Event is a message, presence update, topic change, or roster update
+// received from the XMPP stream.
+type Event struct {
+	Type EventType
+
+	// Room is the MUC JID the event pertains to (Message, Presence,
+	// TopicChange). Empty for RosterEvent.
+	Room string
+
+	// From is the full JID of the sender (Message) or the roster/presence
+	// subject.
+	From string
+
+	// Body is the message text (Message) or the new topic
+	// (TopicChange).
+	Body string
+
+	// Show and Status carry presence details (Presence): Show is one of
+	// "", "away", "dnd", "xa", "chat"; Status is the free-text status
+	// message.
+	Show   string
+	Status string
+
+	// Subscription carries roster details (Roster), e.g. "both", "none".
+	Subscription string
+}
+
+// Session is an authenticated XMPP connection to HipChat's chat server.
+// It reconnects automatically, with exponential backoff, if the
+// connection drops.
+type Session struct {
+	cfg Config
+
+	events chan Event
+	done   chan struct{}
+
+	mu   sync.Mutex
+	conn net.Conn
+	enc  *xml.Encoder
+	dec  *xml.Decoder
+}
+
+// Dial opens and authenticates an XMPP session per cfg, joins no rooms by
+// itself (see JoinRoom/JoinRooms), and starts reading stanzas in the
+// background. If the connection is lost, Dial's caller will keep
+// receiving events once the session reconnects on its own.
+func Dial(cfg Config) (*Session, error) {
+	s := &Session{
+		cfg:    cfg,
+		events: make(chan Event, 64),
+		done:   make(chan struct{}),
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	go s.run()
+	return s, nil
+}
+
+// Incoming returns the channel on which Message, Presence, TopicChange,
+// and Roster events are delivered. It is closed when the Session is
+// closed.
+func (s *Session) Incoming() <-chan Event {
+	return s.events
+}
+
+// Close terminates the session and stops the background reconnect loop.
+func (s *Session) Close() error {
+	close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// connect dials the XMPP server, negotiates TLS, authenticates via SASL
+// PLAIN, and binds a resource. The caller must not hold s.mu.
+func (s *Session) connect() error {
+	conn, err := net.DialTimeout("tcp", s.cfg.host(), 30*time.Second)
+	if err != nil {
+		return err
+	}
+	conn = tls.Client(conn, &tls.Config{ServerName: jidDomain(s.cfg.JID)})
+	domain := jidDomain(s.cfg.JID)
+
+	dec := xml.NewDecoder(conn)
+	if err := negotiateStream(conn, dec, domain); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := authenticatePlain(conn, dec, s.cfg.JID, s.cfg.Password); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// A successful SASL negotiation restarts the stream: the client must
+	// send a fresh stream header and the server replies with a fresh
+	// stream:features advertising resource binding (RFC 6120 §6.4.6).
+	dec = xml.NewDecoder(conn)
+	if err := negotiateStream(conn, dec, domain); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := bindResource(conn, dec); err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	prev := s.conn
+	s.conn = conn
+	s.enc = xml.NewEncoder(conn)
+	s.dec = dec
+	s.mu.Unlock()
+
+	// A reconnect replaces s.conn without anyone else having closed the
+	// old one; close it now so repeated reconnects don't leak a file
+	// descriptor per attempt.
+	if prev != nil {
+		prev.Close()
+	}
+	return nil
+}
+
+// run reads stanzas off the connection, translating them into Events,
+// until the Session is closed. On a read error it reconnects with
+// exponential backoff and keeps going, so a transient network blip
+// doesn't surface as a permanent Incoming() channel closure.
+func (s *Session) run() {
+	defer close(s.events)
+
+	backoff := 500 * time.Millisecond
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		s.mu.Lock()
+		dec := s.dec
+		s.mu.Unlock()
+
+		for {
+			var stanza stanza
+			if err := dec.Decode(&stanza); err != nil {
+				break
+			}
+			backoff = 500 * time.Millisecond
+			if ev, ok := stanza.toEvent(); ok {
+				select {
+				case s.events <- ev:
+				case <-s.done:
+					return
+				}
+			}
+		}
+
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+		s.connect()
+	}
+}
+
+// JoinRoom joins the MUC room at roomJID (a room's XMPPJabberId, see
+// hipchat.Room) under nick.
+func (s *Session) JoinRoom(roomJID, nick string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	presence := fmt.Sprintf(`<presence to="%s/%s"><x xmlns="http://jabber.org/protocol/muc"/></presence>`,
+		xmlEscape(roomJID), xmlEscape(nick))
+	_, err := fmt.Fprint(s.conn, presence)
+	return err
+}
+
+// JoinRooms joins every room in rooms (as returned by Client.RoomList)
+// that has an XMPPJabberId under nick; rooms without one are skipped.
+func (s *Session) JoinRooms(rooms []hipchat.Room, nick string) error {
+	for _, r := range rooms {
+		if len(r.XMPPJabberId) == 0 {
+			continue
+		}
+		if err := s.JoinRoom(r.XMPPJabberId, nick); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send delivers body to room. If cfg.REST was set on the Session's
+// Config, it's sent through the REST API's Client.PostMessage; otherwise
+// it's sent as an XMPP groupchat stanza on this session.
+func (s *Session) Send(room, body string) error {
+	if s.cfg.REST != nil {
+		return s.cfg.REST.PostMessage(hipchat.MessageRequest{
+			RoomId:        room,
+			From:          "bot",
+			Message:       body,
+			MessageFormat: hipchat.FormatText,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := fmt.Sprintf(`<message to="%s" type="groupchat"><body>%s</body></message>`,
+		xmlEscape(room), xmlEscape(body))
+	_, err := fmt.Fprint(s.conn, msg)
+	return err
+}
+
+// negotiateStream writes the stream-open tag to conn and reads the
+// server's response off dec, leaving dec positioned right after
+// </stream:features>, ready to decode the next stanza or SASL response.
+//
+// The <stream:stream> root element is never closed by the server until
+// the connection itself closes, so it can't be read with an ordinary
+// dec.Decode call: that would block waiting for a closing tag that never
+// comes while the stream is alive. Its opening tag is consumed as a raw
+// token instead; everything that follows (starting with
+// <stream:features>) is made up of ordinary, complete elements that
+// Decode handles as usual.
+func negotiateStream(conn net.Conn, dec *xml.Decoder, domain string) error {
+	if _, err := fmt.Fprintf(conn, `<?xml version="1.0"?><stream:stream to="%s" xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams" version="1.0">`,
+		xmlEscape(domain)); err != nil {
+		return err
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "stream" {
+			break
+		}
+	}
+
+	var features streamFeatures
+	return dec.Decode(&features)
+}
+
+// authenticatePlain authenticates over dec via SASL PLAIN, per RFC 6120
+// §6.3-6.4, returning an error if the server reports a failure rather
+// than a success.
+func authenticatePlain(conn net.Conn, dec *xml.Decoder, jid, password string) error {
+	auth := "\x00" + jid + "\x00" + password
+	if _, err := fmt.Fprintf(conn, `<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="PLAIN">%s</auth>`,
+		base64.StdEncoding.EncodeToString([]byte(auth))); err != nil {
+		return err
+	}
+
+	var result saslResult
+	if err := dec.Decode(&result); err != nil {
+		return err
+	}
+	if result.XMLName.Local != "success" {
+		return fmt.Errorf("xmpp: SASL PLAIN authentication failed (%s)", result.XMLName.Local)
+	}
+	return nil
+}
+
+// bindResource requests a server-assigned resource via an IQ bind
+// request, per RFC 6120 §7, returning an error if the server rejects it.
+func bindResource(conn net.Conn, dec *xml.Decoder) error {
+	if _, err := fmt.Fprint(conn, `<iq type="set" id="bind1"><bind xmlns="urn:ietf:params:xml:ns:xmpp-bind"/></iq>`); err != nil {
+		return err
+	}
+
+	var resp bindResponse
+	if err := dec.Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Type == "error" {
+		return errors.New("xmpp: resource bind failed")
+	}
+	return nil
+}
+
+func jidDomain(jid string) string {
+	for i := 0; i < len(jid); i++ {
+		if jid[i] == '@' {
+			return jid[i+1:]
+		}
+	}
+	return jid
+}
+
+func xmlEscape(s string) string {
+	var buf []byte
+	if err := xml.EscapeText(sliceWriter{&buf}, []byte(s)); err != nil {
+		return s
+	}
+	return string(buf)
+}
+
+type sliceWriter struct{ buf *[]byte }
+
+func (w sliceWriter) Write(p []byte) (int, error) {
+	*w.buf = append(*w.buf, p...)
+	return len(p), nil
+}
@@ -0,0 +1,116 @@
+package xmpp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer drives the server side of a handshake over conn: it reads
+// and discards the client's stream-open tag, replies with features and a
+// SASL result, then (on success) repeats the dance for the post-auth
+// stream restart before replying to the resource bind request.
+func fakeServer(t *testing.T, conn net.Conn, saslSuccess bool) {
+	t.Helper()
+	dec := xml.NewDecoder(conn)
+
+	readStreamOpen := func() {
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				t.Errorf("fakeServer: reading stream open: %v", err)
+				return
+			}
+			if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "stream" {
+				return
+			}
+		}
+	}
+
+	readStreamOpen()
+	fmt.Fprint(conn, `<?xml version="1.0"?><stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="jabber:client" version="1.0"><stream:features/>`)
+
+	var auth struct {
+		XMLName xml.Name `xml:"auth"`
+	}
+	if err := dec.Decode(&auth); err != nil {
+		t.Errorf("fakeServer: decoding auth: %v", err)
+		return
+	}
+	if !saslSuccess {
+		fmt.Fprint(conn, `<failure xmlns="urn:ietf:params:xml:ns:xmpp-sasl"><not-authorized/></failure>`)
+		return
+	}
+	fmt.Fprint(conn, `<success xmlns="urn:ietf:params:xml:ns:xmpp-sasl"/>`)
+
+	readStreamOpen()
+	fmt.Fprint(conn, `<?xml version="1.0"?><stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="jabber:client" version="1.0"><stream:features/>`)
+
+	var bind struct {
+		XMLName xml.Name `xml:"iq"`
+	}
+	if err := dec.Decode(&bind); err != nil {
+		t.Errorf("fakeServer: decoding bind iq: %v", err)
+		return
+	}
+	fmt.Fprint(conn, `<iq type="result" id="bind1"/>`)
+
+	fmt.Fprint(conn, `<message from="room@conf.example/nick" type="groupchat"><body>hi</body></message>`)
+}
+
+func TestConnectHandshake(t *testing.T) {
+	client, server := net.Pipe()
+	go fakeServer(t, server, true)
+
+	dec := xml.NewDecoder(client)
+	if err := negotiateStream(client, dec, "example.com"); err != nil {
+		t.Fatalf("negotiateStream: %v", err)
+	}
+	if err := authenticatePlain(client, dec, "user@example.com", "secret"); err != nil {
+		t.Fatalf("authenticatePlain: %v", err)
+	}
+
+	dec = xml.NewDecoder(client)
+	if err := negotiateStream(client, dec, "example.com"); err != nil {
+		t.Fatalf("negotiateStream (post-auth): %v", err)
+	}
+	if err := bindResource(client, dec); err != nil {
+		t.Fatalf("bindResource: %v", err)
+	}
+
+	// The fix under test: Decode must return the live <message> stanza
+	// rather than blocking on the still-open <stream:stream> root.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var s stanza
+		if err := dec.Decode(&s); err != nil {
+			t.Errorf("Decode: %v", err)
+			return
+		}
+		if ev, ok := s.toEvent(); !ok || ev.Body != "hi" {
+			t.Errorf("toEvent() = %+v, %v; want a MessageEvent with Body %q", ev, ok, "hi")
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Decode never returned a stanza off a live stream")
+	}
+}
+
+func TestAuthenticatePlainRejectsFailure(t *testing.T) {
+	client, server := net.Pipe()
+	go fakeServer(t, server, false)
+
+	dec := xml.NewDecoder(client)
+	if err := negotiateStream(client, dec, "example.com"); err != nil {
+		t.Fatalf("negotiateStream: %v", err)
+	}
+	if err := authenticatePlain(client, dec, "user@example.com", "wrong"); err == nil {
+		t.Fatal("authenticatePlain returned nil error for a rejected SASL exchange")
+	}
+}